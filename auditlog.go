@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	auditLogMaxBytes = 10 * 1024 * 1024 // rotate after 10MB
+	auditLogKeep     = 5                // keep this many rotated files
+)
+
+// AuditEntry is one structured line written to the audit log for every env
+// var change that was attempted.
+type AuditEntry struct {
+	Timestamp    time.Time `json:"timestamp"`
+	Source       string    `json:"source"` // poll, sse, webhook, manual
+	Key          string    `json:"key"`
+	OldValue     string    `json:"old_value"`
+	NewValue     string    `json:"new_value"`
+	RestartState string    `json:"restart_state"` // ok, failed, rolled_back, skipped
+}
+
+// AuditLog appends AuditEntry lines as JSON to a size-rotated file. A nil
+// *AuditLog is valid and Write becomes a no-op, so callers don't need to
+// check whether --audit-log was set.
+type AuditLog struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+// newAuditLog opens (creating if needed) the audit log at path. An empty
+// path disables auditing.
+func newAuditLog(path string) (*AuditLog, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log %s: %w", path, err)
+	}
+	return &AuditLog{path: path, file: f}, nil
+}
+
+// Write appends entry as a single JSON line, rotating the file first if it
+// has grown past auditLogMaxBytes.
+func (a *AuditLog) Write(entry AuditEntry) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if info, err := a.file.Stat(); err == nil && info.Size() >= auditLogMaxBytes {
+		if err := a.rotate(); err != nil {
+			log.Printf("audit: failed to rotate %s: %v", a.path, err)
+		}
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("audit: failed to marshal entry: %v", err)
+		return
+	}
+	line = append(line, '\n')
+
+	if _, err := a.file.Write(line); err != nil {
+		log.Printf("audit: failed to write entry to %s: %v", a.path, err)
+	}
+}
+
+// readAuditTail returns up to n of the most recent entries from path, newest
+// first. It only reads the active log file, not rotated .1..N files, which
+// is enough for a dashboard's "recent changes" view. A missing file (audit
+// logging disabled, or nothing written yet) is not an error.
+func readAuditTail(path string, n int) ([]AuditEntry, error) {
+	if path == "" || n <= 0 {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read audit log %s: %w", path, err)
+	}
+
+	var entries []AuditEntry
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry AuditEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	if len(entries) > n {
+		entries = entries[len(entries)-n:]
+	}
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, nil
+}
+
+// rotate renames the current log to path.1, shifting any existing .1..N-1
+// files up, and reopens path fresh. Caller must hold a.mu.
+func (a *AuditLog) rotate() error {
+	a.file.Close()
+
+	for i := auditLogKeep - 1; i >= 1; i-- {
+		from := fmt.Sprintf("%s.%d", a.path, i)
+		to := fmt.Sprintf("%s.%d", a.path, i+1)
+		if _, err := os.Stat(from); err == nil {
+			os.Rename(from, to)
+		}
+	}
+	if err := os.Rename(a.path, a.path+".1"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	f, err := os.OpenFile(a.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("reopen audit log after rotation: %w", err)
+	}
+	a.file = f
+	return nil
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dashboardHistoryLimit bounds how many recent audit entries and snapshots
+// the dashboard renders, so a long-lived install doesn't grow an unbounded
+// page.
+const dashboardHistoryLimit = 20
+
+// DashboardConfig configures the embedded operator dashboard.
+type DashboardConfig struct {
+	Addr     string
+	Username string
+	Password string
+	CertFile string // optional, enables TLS
+	KeyFile  string
+}
+
+// Overrides holds operator-pinned values that win over whatever the config
+// source sends, until unpinned. A nil *Overrides is valid and Get always
+// reports "not pinned", so callers don't need to check whether --ui-addr
+// was set.
+type Overrides struct {
+	mu     sync.Mutex
+	Values map[string]string
+}
+
+func newOverrides() *Overrides {
+	return &Overrides{Values: make(map[string]string)}
+}
+
+// Get reports the pinned value for env, if any.
+func (o *Overrides) Get(env string) (string, bool) {
+	if o == nil {
+		return "", false
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	v, ok := o.Values[env]
+	return v, ok
+}
+
+func (o *Overrides) Set(env, value string) {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.Values[env] = value
+}
+
+func (o *Overrides) Clear(env string) {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.Values, env)
+}
+
+// Snapshot returns a copy of the currently pinned env vars, keyed by name.
+func (o *Overrides) Snapshot() map[string]string {
+	if o == nil {
+		return nil
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	out := make(map[string]string, len(o.Values))
+	for k, v := range o.Values {
+		out[k] = v
+	}
+	return out
+}
+
+// runDashboard starts the operator dashboard and blocks until ctx is
+// cancelled. It shows the watched keys' current values, recent applied
+// changes, snapshot history with one-click rollback, and a manual pin/unpin
+// form.
+func runDashboard(ctx context.Context, cfg DashboardConfig, envPath, auditLogPath string, last *LastSeen, opts DeployOptions) {
+	csrfToken, err := randomToken()
+	if err != nil {
+		log.Printf("dashboard: failed to generate CSRF token, not starting: %v", err)
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		dashboardIndex(w, r, envPath, auditLogPath, csrfToken, last, opts)
+	})
+	mux.HandleFunc("/override", func(w http.ResponseWriter, r *http.Request) {
+		dashboardOverride(w, r, envPath, csrfToken, last, opts)
+	})
+	mux.HandleFunc("/unpin", func(w http.ResponseWriter, r *http.Request) {
+		dashboardUnpin(w, r, csrfToken, opts)
+	})
+	mux.HandleFunc("/rollback", func(w http.ResponseWriter, r *http.Request) {
+		dashboardRollback(w, r, envPath, auditLogPath, csrfToken, opts)
+	})
+
+	srv := &http.Server{Addr: cfg.Addr, Handler: basicAuth(cfg.Username, cfg.Password, mux)}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	if cfg.CertFile != "" {
+		err = srv.ListenAndServeTLS(cfg.CertFile, cfg.KeyFile)
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("dashboard: server error: %v", err)
+	}
+}
+
+// randomToken returns a random 48-hex-character string, used as a
+// per-process CSRF token for the dashboard's state-changing forms.
+func randomToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// validToken reports whether got matches want, in constant time.
+func validToken(want, got string) bool {
+	return subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+// basicAuth wraps next with HTTP Basic Auth, comparing credentials in
+// constant time to avoid a timing oracle.
+func basicAuth(user, pass string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUser, gotPass, ok := r.BasicAuth()
+		userOK := subtle.ConstantTimeCompare([]byte(gotUser), []byte(user)) == 1
+		passOK := subtle.ConstantTimeCompare([]byte(gotPass), []byte(pass)) == 1
+		if !ok || !userOK || !passOK {
+			w.Header().Set("WWW-Authenticate", `Basic realm="succinct-updater"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func dashboardIndex(w http.ResponseWriter, r *http.Request, envPath, auditLogPath, csrfToken string, last *LastSeen, opts DeployOptions) {
+	last.mu.Lock()
+	values := make(map[string]string, len(last.Values))
+	for k, v := range last.Values {
+		values[k] = v
+	}
+	last.mu.Unlock()
+	pinned := opts.Overrides.Snapshot()
+
+	recent, err := readAuditTail(auditLogPath, dashboardHistoryLimit)
+	if err != nil {
+		log.Printf("dashboard: failed to read audit log: %v", err)
+	}
+
+	snaps, err := listSnapshotsOnDisk(opts.Snapshot.Dir)
+	if err != nil {
+		log.Printf("dashboard: failed to list snapshots: %v", err)
+	}
+	sort.Slice(snaps, func(i, j int) bool { return snaps[i].ID > snaps[j].ID })
+	if len(snaps) > dashboardHistoryLimit {
+		snaps = snaps[:dashboardHistoryLimit]
+	}
+
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html><html><head><title>succinct-updater</title>")
+	b.WriteString("<style>body{font-family:sans-serif;margin:2em} table{border-collapse:collapse} td,th{border:1px solid #ccc;padding:4px 8px;text-align:left}</style>")
+	b.WriteString("</head><body>")
+
+	fmt.Fprintf(&b, "<h1>succinct-updater</h1><p>.env: %s</p>", html.EscapeString(envPath))
+
+	b.WriteString("<h2>Watched keys</h2><table><tr><th>Env</th><th>Value</th><th>Pinned</th><th></th></tr>")
+	for _, spec := range opts.Schema.Keys {
+		val := values[spec.Env]
+		pinnedVal, isPinned := pinned[spec.Env]
+		fmt.Fprintf(&b, "<tr><td>%s</td><td>%s</td><td>", html.EscapeString(spec.Env), html.EscapeString(val))
+		if isPinned {
+			fmt.Fprintf(&b, "%s", html.EscapeString(pinnedVal))
+		} else {
+			b.WriteString("&mdash;")
+		}
+		b.WriteString("</td><td>")
+		if isPinned {
+			fmt.Fprintf(&b, `<form method="post" action="/unpin"><input type="hidden" name="env" value="%s"><input type="hidden" name="csrf_token" value="%s"><button>Unpin</button></form>`,
+				html.EscapeString(spec.Env), html.EscapeString(csrfToken))
+		}
+		b.WriteString("</td></tr>")
+	}
+	b.WriteString("</table>")
+
+	b.WriteString("<h2>Pin an override</h2>")
+	b.WriteString(`<form method="post" action="/override"><select name="env">`)
+	for _, spec := range opts.Schema.Keys {
+		fmt.Fprintf(&b, `<option value="%s">%s</option>`, html.EscapeString(spec.Env), html.EscapeString(spec.Env))
+	}
+	fmt.Fprintf(&b, `</select> <input type="text" name="value" placeholder="value"> <input type="hidden" name="csrf_token" value="%s"> <button>Pin</button></form>`,
+		html.EscapeString(csrfToken))
+
+	b.WriteString("<h2>Recent changes</h2><table><tr><th>Time</th><th>Source</th><th>Key</th><th>Old</th><th>New</th><th>Restart</th></tr>")
+	for _, e := range recent {
+		fmt.Fprintf(&b, "<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>",
+			e.Timestamp.Format(time.RFC3339), html.EscapeString(e.Source), html.EscapeString(e.Key),
+			html.EscapeString(e.OldValue), html.EscapeString(e.NewValue), html.EscapeString(e.RestartState))
+	}
+	b.WriteString("</table>")
+
+	b.WriteString("<h2>Snapshots</h2><table><tr><th>ID</th><th>Time</th><th></th></tr>")
+	for _, s := range snaps {
+		fmt.Fprintf(&b, `<tr><td>%s</td><td>%s</td><td><form method="post" action="/rollback"><input type="hidden" name="id" value="%s"><input type="hidden" name="csrf_token" value="%s"><button onclick="return confirm('Roll back to %s?')">Rollback</button></form></td></tr>`,
+			html.EscapeString(s.ID), s.ModTime.Format(time.RFC3339), html.EscapeString(s.ID), html.EscapeString(csrfToken), html.EscapeString(s.ID))
+	}
+	b.WriteString("</table>")
+
+	b.WriteString("</body></html>")
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	io.WriteString(w, b.String())
+}
+
+// dashboardOverride pins an env var to an operator-supplied value and
+// applies it immediately.
+func dashboardOverride(w http.ResponseWriter, r *http.Request, envPath, csrfToken string, last *LastSeen, opts DeployOptions) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad form", http.StatusBadRequest)
+		return
+	}
+	if !validToken(csrfToken, r.FormValue("csrf_token")) {
+		http.Error(w, "bad csrf token", http.StatusForbidden)
+		return
+	}
+	env := r.FormValue("env")
+	value := r.FormValue("value")
+
+	var spec *KeySpec
+	for i := range opts.Schema.Keys {
+		if opts.Schema.Keys[i].Env == env {
+			spec = &opts.Schema.Keys[i]
+			break
+		}
+	}
+	if spec == nil {
+		http.Error(w, fmt.Sprintf("unknown env var %q", env), http.StatusBadRequest)
+		return
+	}
+
+	// Run the pinned value through the same type/range/regex/enum/newline
+	// validation every other config source goes through (evaluateKey calls
+	// validateString for string keys), so a pin can't smuggle in the .env
+	// injection chunk0-5 closed for normal config payloads.
+	raw, err := parseOverrideValue(*spec, value)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	formatted, _, err := evaluateKey(*spec, ConfigPayload{spec.JSON: raw})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	opts.Overrides.Set(env, formatted)
+	if err := applyConfigUpdate(ConfigPayload{}, envPath, last, opts, "manual"); err != nil {
+		log.Printf("dashboard: override apply error: %v", err)
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// parseOverrideValue turns the dashboard's raw form string into the
+// interface{} shape evaluateKey expects for spec's type, matching what
+// encoding/json would have produced for the same value.
+func parseOverrideValue(spec KeySpec, value string) (interface{}, error) {
+	switch spec.Type {
+	case "float", "int":
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: value must be a number", spec.Env)
+		}
+		return f, nil
+	case "bool":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: value must be true or false", spec.Env)
+		}
+		return b, nil
+	case "string":
+		return value, nil
+	default:
+		return nil, fmt.Errorf("key %s: unknown schema type %q", spec.Env, spec.Type)
+	}
+}
+
+// dashboardUnpin removes a manual override. It does not re-apply anything;
+// the next poll/push from the config source will take over for that key.
+func dashboardUnpin(w http.ResponseWriter, r *http.Request, csrfToken string, opts DeployOptions) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad form", http.StatusBadRequest)
+		return
+	}
+	if !validToken(csrfToken, r.FormValue("csrf_token")) {
+		http.Error(w, "bad csrf token", http.StatusForbidden)
+		return
+	}
+	opts.Overrides.Clear(r.FormValue("env"))
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// dashboardRollback restores a snapshot and restarts everything the schema
+// could have touched, mirroring the --rollback CLI subcommand.
+func dashboardRollback(w http.ResponseWriter, r *http.Request, envPath, auditLogPath, csrfToken string, opts DeployOptions) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad form", http.StatusBadRequest)
+		return
+	}
+	if !validToken(csrfToken, r.FormValue("csrf_token")) {
+		http.Error(w, "bad csrf token", http.StatusForbidden)
+		return
+	}
+	id := r.FormValue("id")
+	if !snapshotIDPattern.MatchString(id) {
+		http.Error(w, "invalid snapshot id", http.StatusBadRequest)
+		return
+	}
+
+	if err := rollbackToSnapshot(opts.Schema, opts.Snapshot, envPath, id, opts.DryRun, opts.Audit); err != nil {
+		log.Printf("dashboard: rollback to %s failed: %v", id, err)
+		http.Error(w, fmt.Sprintf("rollback failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
@@ -3,7 +3,7 @@ package main
 import (
 	"bufio"
 	"bytes"
-	"encoding/json"
+	"context"
 	"flag"
 	"fmt"
 	"io"
@@ -11,9 +11,13 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
@@ -23,22 +27,34 @@ const (
 	envMaxConcurrency = "BIDDER_MAX_CONCURRENT_PROOFS"
 )
 
-// ConfigPayload matches the JSON from the Succinct dashboard.
-type ConfigPayload struct {
-	SmallBid       *float64 `json:"small_bid"`
-	LargeBid       *float64 `json:"large_bid"`
-	MaxConcurrency *int     `json:"max_concurrency"`
-}
+// ConfigPayload is the JSON payload from the dashboard (or whatever
+// ConfigSource is in use), keyed by the "json" field name declared for each
+// key in the schema. Values are whatever encoding/json produces: float64,
+// string, bool, or nil.
+type ConfigPayload map[string]interface{}
 
-// LastSeen keeps the last values we've applied.
+// LastSeen keeps the last string value applied for each watched env var. It
+// is shared between the poll loop, the SSE watcher, and the webhook
+// receiver, so all access goes through mu.
 type LastSeen struct {
-	SmallBid          float64
-	HasSmallBid       bool
-	LargeBid          float64
-	HasLargeBid       bool
-	MaxConcurrency    int
-	HasMaxConcurrency bool
-	Initialized       bool
+	mu sync.Mutex
+
+	Values      map[string]string
+	Initialized bool
+}
+
+// DeployOptions bundles everything applyConfigUpdate needs to turn a write
+// into a supervised deploy: the key schema, whether to actually touch
+// systemd, where to snapshot the .env before writing it, and how to decide
+// the restart worked.
+type DeployOptions struct {
+	Schema    *Schema
+	DryRun    bool
+	Snapshot  SnapshotConfig
+	Health    HealthCheck
+	Metrics   *Metrics
+	Audit     *AuditLog
+	Overrides *Overrides
 }
 
 func main() {
@@ -47,17 +63,101 @@ func main() {
 	//envPathFlag := flag.String("env", "~/sp1-cluster/infra/.env", "Path to .env file")
 	envPathFlag := flag.String("env", "~/Desktop/succinct_clone/infra/.env", "Path to .env file")
 	dryRun := flag.Bool("dry-run", false, "If true, don't run systemctl commands (good for local testing)")
+	streamEndpoint := flag.String("stream-endpoint", "", "SSE endpoint to watch for pushed config (e.g. http://localhost:8080/config/stream). Disabled if empty")
+	webhookAddr := flag.String("webhook-addr", "", "Address to listen on for signed webhook config pushes (e.g. :9090). Disabled if empty")
+	webhookSecret := flag.String("webhook-secret", "", "Shared secret used to verify the HMAC-SHA256 signature on incoming webhooks")
+	snapshotDir := flag.String("snapshot-dir", "", "Directory to store .env snapshots before each write (default: <env-dir>/.env.d/history)")
+	snapshotKeep := flag.Int("snapshot-keep", 10, "Number of .env snapshots to retain")
+	healthCheck := flag.String("health-check", "none", "Post-restart health probe: none, http, exec, or systemd")
+	healthURL := flag.String("health-url", "", "URL to GET for --health-check=http")
+	healthCmd := flag.String("health-cmd", "", "Shell command to run for --health-check=exec (exit 0 == healthy)")
+	healthStability := flag.Duration("health-stability", 5*time.Second, "How long the probe must report healthy before a deploy is considered successful")
+	healthTimeout := flag.Duration("health-timeout", 30*time.Second, "How long to wait for the probe to stabilize before rolling back")
+	rollbackID := flag.String("rollback", "", "Restore the named snapshot, restart every unit and hook in the schema, and exit")
+	listSnapshots := flag.Bool("list-snapshots", false, "List available .env snapshots and exit")
+	metricsAddr := flag.String("metrics-addr", "", "Address to serve Prometheus metrics on (e.g. :9091). Disabled if empty")
+	auditLogPath := flag.String("audit-log", "", "Path to a rotating JSON audit log of applied config changes. Disabled if empty")
+	sourceURL := flag.String("source", "", "Config source URL (http(s)://, consul://, etcd://, file://, git://). Defaults to --endpoint over HTTP")
+	schemaPath := flag.String("schema", "", "Path to a schema file (updater.yaml) declaring watched keys, types, validation, and target units. Defaults to the built-in small/large-bid/max-concurrency schema")
+	uiAddr := flag.String("ui-addr", "", "Address to serve the operator dashboard on (e.g. :9092). Disabled if empty")
+	uiUser := flag.String("ui-user", "admin", "HTTP Basic Auth username for the dashboard")
+	uiPass := flag.String("ui-pass", "", "HTTP Basic Auth password for the dashboard. Falls back to $UPDATER_UI_PASSWORD, required if --ui-addr is set")
+	uiCert := flag.String("ui-cert", "", "TLS certificate for the dashboard (serves plain HTTP if empty)")
+	uiKey := flag.String("ui-key", "", "TLS key for the dashboard, required if --ui-cert is set")
 	flag.Parse()
 
+	schema := defaultSchema()
+	if *schemaPath != "" {
+		var err error
+		schema, err = loadSchema(*schemaPath)
+		if err != nil {
+			log.Fatalf("failed to load --schema: %v", err)
+		}
+	}
+
 	envPath, err := expandPath(*envPathFlag)
 	if err != nil {
 		log.Fatalf("failed to resolve .env path: %v", err)
 	}
 
+	snapDir := *snapshotDir
+	if snapDir == "" {
+		snapDir = defaultSnapshotDir(envPath)
+	}
+	snapCfg := SnapshotConfig{Dir: snapDir, Keep: *snapshotKeep}
+
+	if *listSnapshots {
+		runListSnapshots(snapCfg)
+		return
+	}
+	if *rollbackID != "" {
+		runRollback(schema, snapCfg, envPath, *rollbackID, *dryRun, *auditLogPath)
+		return
+	}
+
+	if *webhookAddr != "" && *webhookSecret == "" {
+		log.Fatalf("--webhook-secret is required when --webhook-addr is set")
+	}
+
+	uiPassword := *uiPass
+	if uiPassword == "" {
+		uiPassword = os.Getenv("UPDATER_UI_PASSWORD")
+	}
+	if *uiAddr != "" && uiPassword == "" {
+		log.Fatalf("--ui-pass (or $UPDATER_UI_PASSWORD) is required when --ui-addr is set")
+	}
+	if *uiCert != "" && *uiKey == "" {
+		log.Fatalf("--ui-key is required when --ui-cert is set")
+	}
+
+	healthCfg := HealthCheck{
+		Mode:      *healthCheck,
+		URL:       *healthURL,
+		Cmd:       *healthCmd,
+		Stability: *healthStability,
+		Timeout:   *healthTimeout,
+	}
+
+	auditLog, err := newAuditLog(*auditLogPath)
+	if err != nil {
+		log.Fatalf("failed to open audit log: %v", err)
+	}
+
+	opts := DeployOptions{
+		Schema:    schema,
+		DryRun:    *dryRun,
+		Snapshot:  snapCfg,
+		Health:    healthCfg,
+		Metrics:   newMetrics(),
+		Audit:     auditLog,
+		Overrides: newOverrides(),
+	}
+
 	log.Printf("Starting bidder config watcher")
 	log.Printf("Endpoint: %s", *endpoint)
 	log.Printf("Interval: %s", *interval)
 	log.Printf(".env path: %s", envPath)
+	log.Printf("Snapshot dir: %s (keep %d)", snapCfg.Dir, snapCfg.Keep)
 	if *dryRun {
 		log.Printf("Dry-run mode: systemctl commands will NOT be executed")
 	}
@@ -66,20 +166,192 @@ func main() {
 		Timeout: 10 * time.Second,
 	}
 
-	ticker := time.NewTicker(*interval)
-	defer ticker.Stop()
+	// http.Client.Timeout bounds the whole request, including the time spent
+	// reading the body — fine for one-shot Fetch calls, fatal for a
+	// long-lived SSE stream, which would get force-closed every 10s
+	// regardless of traffic. The stream relies on ctx cancellation instead
+	// (see streamOnce), so it gets its own client with no Timeout set.
+	streamClient := &http.Client{}
+
+	var source ConfigSource
+	if *sourceURL != "" {
+		source, err = parseSource(*sourceURL, client, *interval)
+		if err != nil {
+			log.Fatalf("failed to configure --source: %v", err)
+		}
+		log.Printf("Config source: %s", *sourceURL)
+	} else {
+		source = &httpConfigSource{endpoint: *endpoint, client: client, pollInterval: *interval}
+	}
+
+	last := &LastSeen{Values: make(map[string]string)}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var wg sync.WaitGroup
+
+	if *streamEndpoint != "" {
+		log.Printf("Stream endpoint: %s", *streamEndpoint)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			watchSSE(ctx, streamClient, *streamEndpoint, func(payload ConfigPayload) {
+				if err := applyConfigUpdate(payload, envPath, last, opts, "sse"); err != nil {
+					log.Printf("sse apply error: %v", err)
+				}
+			})
+		}()
+	}
+
+	if *webhookAddr != "" {
+		log.Printf("Webhook receiver: %s", *webhookAddr)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runWebhookReceiver(ctx, *webhookAddr, *webhookSecret, func(payload ConfigPayload) {
+				if err := applyConfigUpdate(payload, envPath, last, opts, "webhook"); err != nil {
+					log.Printf("webhook apply error: %v", err)
+				}
+			})
+		}()
+	}
+
+	if *metricsAddr != "" {
+		log.Printf("Metrics endpoint: %s/metrics", *metricsAddr)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runMetricsServer(ctx, *metricsAddr, opts.Metrics)
+		}()
+	}
+
+	if *uiAddr != "" {
+		log.Printf("Dashboard: %s", *uiAddr)
+		dashCfg := DashboardConfig{
+			Addr:     *uiAddr,
+			Username: *uiUser,
+			Password: uiPassword,
+			CertFile: *uiCert,
+			KeyFile:  *uiKey,
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runDashboard(ctx, dashCfg, envPath, *auditLogPath, last, opts)
+		}()
+	}
+
+	watchSource(ctx, source, envPath, last, opts)
+	wg.Wait()
+}
+
+// watchSource applies one immediate Fetch so config lands without waiting
+// out a full interval, then hands off to source.Watch for everything after.
+// Watch pushes payloads the moment they're available for sources that
+// support it natively (Consul's blocking queries, etcd's streaming watch),
+// and falls back to polling on --interval for sources that can't (see
+// pollingWatch) -- either way this is the only place the config source's
+// payloads get applied after startup (SSE, webhook and dashboard updates
+// arrive through their own goroutines). Blocks until ctx is cancelled.
+func watchSource(ctx context.Context, source ConfigSource, envPath string, last *LastSeen, opts DeployOptions) {
+	if err := pollAndUpdate(ctx, source, envPath, last, opts); err != nil {
+		log.Printf("poll error: %v", err)
+	}
 
-	last := &LastSeen{}
+	updates, err := source.Watch(ctx)
+	if err != nil {
+		log.Printf("failed to watch config source: %v", err)
+		return
+	}
 
-	// First immediate poll, then periodic.
 	for {
-		if err := pollAndUpdate(client, *endpoint, envPath, last, *dryRun); err != nil {
-			log.Printf("poll error: %v", err)
+		select {
+		case <-ctx.Done():
+			return
+		case payload, ok := <-updates:
+			if !ok {
+				return
+			}
+			err := applyConfigUpdate(payload, envPath, last, opts, "poll")
+			opts.Metrics.RecordPoll(err)
+			if err != nil {
+				log.Printf("poll error: %v", err)
+			}
 		}
-		<-ticker.C
 	}
 }
 
+// runListSnapshots implements the --list-snapshots subcommand.
+func runListSnapshots(snapCfg SnapshotConfig) {
+	snaps, err := listSnapshotsOnDisk(snapCfg.Dir)
+	if err != nil {
+		log.Fatalf("failed to list snapshots: %v", err)
+	}
+	if len(snaps) == 0 {
+		fmt.Println("no snapshots found in", snapCfg.Dir)
+		return
+	}
+	for _, s := range snaps {
+		fmt.Printf("%s\t%s\n", s.ID, s.ModTime.Format(time.RFC3339))
+	}
+}
+
+// runRollback implements the --rollback subcommand: restore a snapshot and
+// restart every unit in the schema against it (we don't know which keys the
+// snapshot changed, so we restart everything it's allowed to touch).
+func runRollback(schema *Schema, snapCfg SnapshotConfig, envPath, id string, dryRun bool, auditLogPath string) {
+	auditLog, err := newAuditLog(auditLogPath)
+	if err != nil {
+		log.Fatalf("failed to open audit log: %v", err)
+	}
+
+	if err := rollbackToSnapshot(schema, snapCfg, envPath, id, dryRun, auditLog); err != nil {
+		log.Fatalf("rollback failed: %v", err)
+	}
+	log.Printf("Rolled back to snapshot %s", id)
+}
+
+// rollbackToSnapshot restores snapshot id and restarts every unit/hook the
+// schema could have touched, writing a single audit entry recording the
+// outcome. It is the shared implementation behind --rollback and the
+// dashboard's rollback button.
+func rollbackToSnapshot(schema *Schema, snapCfg SnapshotConfig, envPath, id string, dryRun bool, auditLog *AuditLog) error {
+	if err := restoreSnapshot(snapCfg.Dir, id, envPath); err != nil {
+		return err
+	}
+
+	allUnits, allHooks := unitsAndHooksFor(schema, allEnvVars(schema))
+	restartErr := restartUnits(allUnits, dryRun)
+	if restartErr == nil {
+		restartErr = runHooks(allHooks, dryRun)
+	}
+
+	state := "ok"
+	if restartErr != nil {
+		state = "failed"
+	}
+	auditLog.Write(AuditEntry{
+		Timestamp:    time.Now(),
+		Source:       "manual",
+		Key:          "rollback",
+		NewValue:     id,
+		RestartState: state,
+	})
+
+	return restartErr
+}
+
+// allEnvVars returns a set containing every env var in the schema, used by
+// rollback to restart everything a snapshot could plausibly have changed.
+func allEnvVars(schema *Schema) map[string]bool {
+	all := make(map[string]bool, len(schema.Keys))
+	for _, spec := range schema.Keys {
+		all[spec.Env] = true
+	}
+	return all
+}
+
 func expandPath(path string) (string, error) {
 	if strings.HasPrefix(path, "~/") || path == "~" {
 		home, err := os.UserHomeDir()
@@ -94,39 +366,53 @@ func expandPath(path string) (string, error) {
 	return path, nil
 }
 
-func pollAndUpdate(client *http.Client, endpoint, envPath string, last *LastSeen, dryRun bool) error {
-	resp, err := client.Get(endpoint)
+func pollAndUpdate(ctx context.Context, source ConfigSource, envPath string, last *LastSeen, opts DeployOptions) error {
+	payload, err := source.Fetch(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to GET %s: %w", endpoint, err)
+		opts.Metrics.RecordPoll(err)
+		return fmt.Errorf("failed to fetch config: %w", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := ioReadAllLimit(resp.Body, 1024)
-		return fmt.Errorf("unexpected status %d from endpoint: %s", resp.StatusCode, string(body))
-	}
+	err = applyConfigUpdate(payload, envPath, last, opts, "poll")
+	opts.Metrics.RecordPoll(err)
+	return err
+}
 
-	var payload ConfigPayload
-	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
-		return fmt.Errorf("failed to decode JSON: %w", err)
-	}
+// applyConfigUpdate diffs payload against last per the schema, and if
+// anything changed, writes the .env file and restarts whichever units (or
+// hooks) own the changed keys. It is the common landing point for every
+// config delivery mechanism (poll, SSE, webhook, dashboard). source
+// identifies the caller in the audit log.
+func applyConfigUpdate(payload ConfigPayload, envPath string, last *LastSeen, opts DeployOptions, source string) error {
+	last.mu.Lock()
+	defer last.mu.Unlock()
 
 	updates := make(map[string]string)
-
-	// Detect changes vs last-seen values.
-	if payload.SmallBid != nil {
-		if !last.Initialized || !last.HasSmallBid || last.SmallBid != *payload.SmallBid {
-			updates[envSmallBid] = formatFloat(*payload.SmallBid)
+	oldValues := make(map[string]string)
+	changedEnvVars := make(map[string]bool)
+
+	for _, spec := range opts.Schema.Keys {
+		var val string
+		var present bool
+
+		if pinned, ok := opts.Overrides.Get(spec.Env); ok {
+			// A manual override from the dashboard wins over whatever the
+			// config source sent, until an operator unpins it.
+			val, present = pinned, true
+		} else {
+			var err error
+			val, present, err = evaluateKey(spec, payload)
+			if err != nil {
+				return fmt.Errorf("invalid config payload: %w", err)
+			}
 		}
-	}
-	if payload.LargeBid != nil {
-		if !last.Initialized || !last.HasLargeBid || last.LargeBid != *payload.LargeBid {
-			updates[envLargeBid] = formatFloat(*payload.LargeBid)
+		if !present {
+			continue
 		}
-	}
-	if payload.MaxConcurrency != nil {
-		if !last.Initialized || !last.HasMaxConcurrency || last.MaxConcurrency != *payload.MaxConcurrency {
-			updates[envMaxConcurrency] = fmt.Sprintf("%d", *payload.MaxConcurrency)
+		if !last.Initialized || last.Values[spec.Env] != val {
+			updates[spec.Env] = val
+			oldValues[spec.Env] = last.Values[spec.Env]
+			changedEnvVars[spec.Env] = true
 		}
 	}
 
@@ -137,10 +423,13 @@ func pollAndUpdate(client *http.Client, endpoint, envPath string, last *LastSeen
 
 	log.Printf("Detected changes from endpoint: %+v", updates)
 
-	// Safely update .env (sed-like line replacement, atomic write).
-	if err := updateEnvFile(envPath, updates); err != nil {
+	// Snapshot the current .env before touching it, so a bad deploy can be
+	// reverted automatically (or manually via --rollback).
+	snapID, err := updateEnvFile(envPath, updates, opts.Snapshot)
+	if err != nil {
 		return fmt.Errorf("failed to update .env: %w", err)
 	}
+	opts.Metrics.RecordEnvWrite()
 
 	// Confirm changes by re-reading the file.
 	if err := confirmEnvValues(envPath, updates); err != nil {
@@ -148,49 +437,140 @@ func pollAndUpdate(client *http.Client, endpoint, envPath string, last *LastSeen
 	}
 
 	// Update last-seen cache ONLY after successful write.
-	if payload.SmallBid != nil {
-		last.SmallBid = *payload.SmallBid
-		last.HasSmallBid = true
+	for env, val := range updates {
+		last.Values[env] = val
 	}
-	if payload.LargeBid != nil {
-		last.LargeBid = *payload.LargeBid
-		last.HasLargeBid = true
+	last.Initialized = true
+	opts.Metrics.SetApplied(bidderGaugesFrom(last))
+
+	// Restart exactly the units (and run the hooks) whose keys changed,
+	// each once, even if several changed keys target the same unit.
+	units, hooks := unitsAndHooksFor(opts.Schema, changedEnvVars)
+
+	restartStart := time.Now()
+	restartErr := restartUnits(units, opts.DryRun)
+	if restartErr == nil {
+		restartErr = runHooks(hooks, opts.DryRun)
 	}
-	if payload.MaxConcurrency != nil {
-		last.MaxConcurrency = *payload.MaxConcurrency
-		last.HasMaxConcurrency = true
+	opts.Metrics.RecordRestart(time.Since(restartStart))
+
+	if restartErr != nil {
+		log.Printf("WARNING: failed to restart %v: %v", units, restartErr)
+		writeAuditEntries(opts.Audit, source, updates, oldValues, "failed")
+		return nil
 	}
-	last.Initialized = true
+	log.Printf("Successfully restarted %v", units)
 
-	// Reload systemd and restart bidder.
-	if err := reloadAndRestart(dryRun); err != nil {
-		log.Printf("WARNING: failed to reload/restart bidder: %v", err)
-	} else {
-		log.Printf("Successfully reloaded systemd and restarted bidder")
+	if opts.DryRun {
+		writeAuditEntries(opts.Audit, source, updates, oldValues, "skipped")
+		return nil
+	}
+
+	probeCtx, cancel := context.WithTimeout(context.Background(), opts.Health.Timeout+time.Second)
+	defer cancel()
+
+	if err := probeHealthy(probeCtx, opts.Health, units); err != nil {
+		log.Printf("WARNING: health check failed after restarting %v: %v", units, err)
+		writeAuditEntries(opts.Audit, source, updates, oldValues, "rolled_back")
+		return rollbackDeploy(envPath, last, opts, snapID, units, hooks, err)
 	}
 
+	writeAuditEntries(opts.Audit, source, updates, oldValues, "ok")
 	return nil
 }
 
+// bidderGaugesFrom pulls the three original bidder values out of the
+// generic last-seen map for the Prometheus gauges, defaulting to zero for
+// schemas that don't declare them.
+func bidderGaugesFrom(last *LastSeen) (small, large float64, maxConcurrency int) {
+	small, _ = strconv.ParseFloat(last.Values[envSmallBid], 64)
+	large, _ = strconv.ParseFloat(last.Values[envLargeBid], 64)
+	maxConcurrency, _ = strconv.Atoi(last.Values[envMaxConcurrency])
+	return small, large, maxConcurrency
+}
+
+// writeAuditEntries records one AuditEntry per changed key.
+func writeAuditEntries(audit *AuditLog, source string, updates, oldValues map[string]string, restartState string) {
+	now := time.Now()
+	for key, newVal := range updates {
+		audit.Write(AuditEntry{
+			Timestamp:    now,
+			Source:       source,
+			Key:          key,
+			OldValue:     oldValues[key],
+			NewValue:     newVal,
+			RestartState: restartState,
+		})
+	}
+}
+
+// rollbackDeploy restores the .env snapshot taken just before a failed
+// deploy, restarts whichever units/hooks own the keys that were just
+// changed, and returns an error describing the original failure so callers
+// know the deploy did not land.
+func rollbackDeploy(envPath string, last *LastSeen, opts DeployOptions, snapID string, units, hooks []string, cause error) error {
+	if snapID == "" {
+		return fmt.Errorf("deploy failed health check and no snapshot is available to roll back to: %w", cause)
+	}
+
+	if err := restoreSnapshot(opts.Snapshot.Dir, snapID, envPath); err != nil {
+		return fmt.Errorf("deploy failed health check (%v), and rollback to snapshot %s failed: %w", cause, snapID, err)
+	}
+
+	restored, err := os.ReadFile(envPath)
+	if err != nil {
+		return fmt.Errorf("deploy failed health check (%v), rolled back to %s but could not re-read .env: %w", cause, snapID, err)
+	}
+	resetLastFromEnv(last, restored)
+
+	restartErr := restartUnits(units, opts.DryRun)
+	if restartErr == nil {
+		restartErr = runHooks(hooks, opts.DryRun)
+	}
+	if restartErr != nil {
+		return fmt.Errorf("deploy failed health check (%v), rolled back to %s, but restart after rollback also failed: %w", cause, snapID, restartErr)
+	}
+
+	log.Printf("Rolled back to snapshot %s after failed health check", snapID)
+	return fmt.Errorf("deploy failed health check and was rolled back to snapshot %s: %w", snapID, cause)
+}
+
+// resetLastFromEnv resyncs the in-memory last-seen cache with the env vars
+// actually on disk, e.g. after restoring a snapshot out from under it.
+func resetLastFromEnv(last *LastSeen, data []byte) {
+	found := parseEnvToMap(data)
+	for k, v := range found {
+		last.Values[k] = v
+	}
+	last.Initialized = true
+}
+
 func formatFloat(f float64) string {
 	// Keep enough precision but avoid trailing zeros insanity.
 	return strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.6f", f), "0"), ".")
 }
 
 // updateEnvFile parses the existing .env, modifies only changed vars (sed-like),
-// and rewrites atomically.
-func updateEnvFile(path string, updates map[string]string) error {
+// snapshots the previous contents, and rewrites atomically. It returns the
+// snapshot ID that was taken (empty if snapshotting was disabled or there was
+// no previous file to snapshot).
+func updateEnvFile(path string, updates map[string]string, snapCfg SnapshotConfig) (string, error) {
 	var content string
 
 	originalInfo, statErr := os.Stat(path)
 	if statErr == nil {
 		data, err := os.ReadFile(path)
 		if err != nil {
-			return fmt.Errorf("read .env: %w", err)
+			return "", fmt.Errorf("read .env: %w", err)
 		}
 		content = string(data)
 	} else if !os.IsNotExist(statErr) {
-		return fmt.Errorf("stat .env: %w", statErr)
+		return "", fmt.Errorf("stat .env: %w", statErr)
+	}
+
+	snapID, err := takeSnapshot(snapCfg, path)
+	if err != nil {
+		return "", fmt.Errorf("snapshot .env before write: %w", err)
 	}
 
 	changed := make(map[string]bool, len(updates))
@@ -228,13 +608,36 @@ func updateEnvFile(path string, updates map[string]string) error {
 		content += "\n"
 	}
 
-	// Atomic write: write to temp in same dir, chmod, fsync, rename.
+	var perm os.FileMode
+	if statErr == nil {
+		perm = originalInfo.Mode().Perm()
+	}
+	if err := writeFileAtomicPerm(path, []byte(content), perm, statErr == nil); err != nil {
+		return "", err
+	}
+
+	log.Printf("Updated .env at %s with keys: %v", path, keysOf(updates))
+	return snapID, nil
+}
+
+// writeFileAtomic writes data to path via a temp-file-plus-rename, using the
+// permissions of any file it replaces (or 0o600 for a new file).
+func writeFileAtomic(path string, data []byte) error {
+	info, statErr := os.Stat(path)
+	var perm os.FileMode = 0o600
+	if statErr == nil {
+		perm = info.Mode().Perm()
+	}
+	return writeFileAtomicPerm(path, data, perm, statErr == nil)
+}
+
+func writeFileAtomicPerm(path string, data []byte, perm os.FileMode, applyPerm bool) error {
 	dir := filepath.Dir(path)
 	base := filepath.Base(path)
 
 	tmpFile, err := os.CreateTemp(dir, base+".tmp-*")
 	if err != nil {
-		return fmt.Errorf("create temp .env: %w", err)
+		return fmt.Errorf("create temp %s: %w", base, err)
 	}
 	tmpName := tmpFile.Name()
 	defer func() {
@@ -242,28 +645,26 @@ func updateEnvFile(path string, updates map[string]string) error {
 		os.Remove(tmpName)
 	}()
 
-	// Preserve permissions if original existed.
-	if statErr == nil {
-		if err := os.Chmod(tmpName, originalInfo.Mode().Perm()); err != nil {
+	if applyPerm {
+		if err := os.Chmod(tmpName, perm); err != nil {
 			return fmt.Errorf("chmod temp: %w", err)
 		}
 	}
 
-	if _, err := tmpFile.WriteString(content); err != nil {
-		return fmt.Errorf("write temp .env: %w", err)
+	if _, err := tmpFile.Write(data); err != nil {
+		return fmt.Errorf("write temp %s: %w", base, err)
 	}
 	if err := tmpFile.Sync(); err != nil {
-		return fmt.Errorf("sync temp .env: %w", err)
+		return fmt.Errorf("sync temp %s: %w", base, err)
 	}
 	if err := tmpFile.Close(); err != nil {
-		return fmt.Errorf("close temp .env: %w", err)
+		return fmt.Errorf("close temp %s: %w", base, err)
 	}
 
 	if err := os.Rename(tmpName, path); err != nil {
-		return fmt.Errorf("rename temp -> .env: %w", err)
+		return fmt.Errorf("rename temp -> %s: %w", base, err)
 	}
 
-	log.Printf("Updated .env at %s with keys: %v", path, keysOf(updates))
 	return nil
 }
 
@@ -310,16 +711,25 @@ func parseEnvToMap(data []byte) map[string]string {
 	return result
 }
 
-func reloadAndRestart(dryRun bool) error {
+// restartUnits reloads systemd once (if there's anything to restart) and
+// restarts each unit in order. It is a no-op if units is empty, so a
+// payload that only changes hook-driven keys doesn't touch systemd at all.
+func restartUnits(units []string, dryRun bool) error {
+	if len(units) == 0 {
+		return nil
+	}
+
 	if dryRun {
 		log.Printf("[dry-run] Would run: sudo systemctl daemon-reload")
-		log.Printf("[dry-run] Would run: sudo systemctl restart bidder")
+		for _, unit := range units {
+			log.Printf("[dry-run] Would run: sudo systemctl restart %s", unit)
+		}
 		return nil
 	}
 
-	commands := [][]string{
-		{"sudo", "systemctl", "daemon-reload"},
-		{"sudo", "systemctl", "restart", "bidder"},
+	commands := [][]string{{"sudo", "systemctl", "daemon-reload"}}
+	for _, unit := range units {
+		commands = append(commands, []string{"sudo", "systemctl", "restart", unit})
 	}
 
 	for _, args := range commands {
@@ -334,6 +744,24 @@ func reloadAndRestart(dryRun bool) error {
 	return nil
 }
 
+// runHooks runs each hook's shell command in turn, stopping at the first
+// failure.
+func runHooks(hooks []string, dryRun bool) error {
+	for _, hook := range hooks {
+		if dryRun {
+			log.Printf("[dry-run] Would run hook: %s", hook)
+			continue
+		}
+		cmd := exec.Command("sh", "-c", hook)
+		out, err := cmd.CombinedOutput()
+		log.Printf("Ran hook %q, output:\n%s", hook, string(out))
+		if err != nil {
+			return fmt.Errorf("hook %q failed: %w", hook, err)
+		}
+	}
+	return nil
+}
+
 func keysOf(m map[string]string) []string {
 	r := make([]string, 0, len(m))
 	for k := range m {
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics holds the counters, gauges, and histogram backing the /metrics
+// endpoint. All fields are safe for concurrent use. A nil *Metrics is valid
+// for the Record* and SetApplied methods, which become no-ops, so callers
+// don't need to check whether --metrics-addr was set; ServeHTTP needs a
+// non-nil *Metrics.
+type Metrics struct {
+	pollSuccessTotal uint64
+	pollErrorTotal   uint64
+	envWritesTotal   uint64
+	lastSuccessUnix  int64
+
+	restartDuration *histogram
+
+	mu             sync.Mutex
+	smallBid       float64
+	largeBid       float64
+	maxConcurrency int
+}
+
+func newMetrics() *Metrics {
+	return &Metrics{
+		restartDuration: newHistogram([]float64{0.1, 0.5, 1, 2, 5, 10, 30, 60}),
+	}
+}
+
+func (m *Metrics) RecordPoll(err error) {
+	if m == nil {
+		return
+	}
+	if err != nil {
+		atomic.AddUint64(&m.pollErrorTotal, 1)
+		return
+	}
+	atomic.AddUint64(&m.pollSuccessTotal, 1)
+	atomic.StoreInt64(&m.lastSuccessUnix, time.Now().Unix())
+}
+
+func (m *Metrics) RecordEnvWrite() {
+	if m == nil {
+		return
+	}
+	atomic.AddUint64(&m.envWritesTotal, 1)
+}
+
+func (m *Metrics) RecordRestart(d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.restartDuration.observe(d.Seconds())
+}
+
+func (m *Metrics) SetApplied(small, large float64, maxConcurrency int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.smallBid = small
+	m.largeBid = large
+	m.maxConcurrency = maxConcurrency
+}
+
+// ServeHTTP renders the current values in Prometheus text exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	small, large, maxConc := m.smallBid, m.largeBid, m.maxConcurrency
+	m.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	writeMetric(w, "succinct_updater_poll_total", "counter", "Total number of endpoint polls by result.", func(w io.Writer) {
+		fmt.Fprintf(w, "succinct_updater_poll_total{result=\"success\"} %d\n", atomic.LoadUint64(&m.pollSuccessTotal))
+		fmt.Fprintf(w, "succinct_updater_poll_total{result=\"error\"} %d\n", atomic.LoadUint64(&m.pollErrorTotal))
+	})
+
+	writeMetric(w, "succinct_updater_env_writes_total", "counter", "Total number of .env writes applied.", func(w io.Writer) {
+		fmt.Fprintf(w, "succinct_updater_env_writes_total %d\n", atomic.LoadUint64(&m.envWritesTotal))
+	})
+
+	writeMetric(w, "succinct_updater_last_success_timestamp_seconds", "gauge", "Unix time of the last successful poll.", func(w io.Writer) {
+		fmt.Fprintf(w, "succinct_updater_last_success_timestamp_seconds %d\n", atomic.LoadInt64(&m.lastSuccessUnix))
+	})
+
+	writeMetric(w, "succinct_updater_small_bid", "gauge", "Currently applied small_bid value.", func(w io.Writer) {
+		fmt.Fprintf(w, "succinct_updater_small_bid %s\n", formatMetricFloat(small))
+	})
+	writeMetric(w, "succinct_updater_large_bid", "gauge", "Currently applied large_bid value.", func(w io.Writer) {
+		fmt.Fprintf(w, "succinct_updater_large_bid %s\n", formatMetricFloat(large))
+	})
+	writeMetric(w, "succinct_updater_max_concurrency", "gauge", "Currently applied max_concurrency value.", func(w io.Writer) {
+		fmt.Fprintf(w, "succinct_updater_max_concurrency %d\n", maxConc)
+	})
+
+	m.restartDuration.writeTo(w, "succinct_updater_restart_duration_seconds", "Time spent reloading systemd and restarting the bidder, in seconds.")
+}
+
+func writeMetric(w io.Writer, name, typ, help string, body func(io.Writer)) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, typ)
+	body(w)
+}
+
+func formatMetricFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// histogram is a minimal cumulative-bucket histogram, hand-rolled to avoid
+// pulling in the Prometheus client library for a few gauges and counters.
+type histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *histogram) observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sum += v
+	h.count++
+	for i, b := range h.buckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+}
+
+func (h *histogram) writeTo(w io.Writer, name, help string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	writeMetric(w, name, "histogram", help, func(w io.Writer) {
+		for i, b := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", name, formatMetricFloat(b), h.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+		fmt.Fprintf(w, "%s_sum %s\n", name, formatMetricFloat(h.sum))
+		fmt.Fprintf(w, "%s_count %d\n", name, h.count)
+	})
+}
+
+// runMetricsServer starts the /metrics HTTP server and blocks until ctx is
+// cancelled.
+func runMetricsServer(ctx context.Context, addr string, m *Metrics) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m)
+
+	srv := &http.Server{Addr: addr, Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("metrics: server error: %v", err)
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Schema declares every config key the updater watches: its env var, its
+// JSON field in the incoming payload, its value type, optional validation
+// constraints, and which systemd unit(s) or shell hook to restart when it
+// changes. It replaces the three keys hardcoded into earlier versions of
+// this tool with an arbitrary list loaded from --schema (updater.yaml).
+type Schema struct {
+	Keys []KeySpec
+}
+
+// KeySpec is one watched key.
+type KeySpec struct {
+	Env   string   // env var name, e.g. BID_SMALL_AMOUNT
+	JSON  string   // field name in the config payload, e.g. small_bid
+	Type  string   // float, int, string, or bool
+	Min   *float64 // optional, float/int only
+	Max   *float64 // optional, float/int only
+	Regex string   // optional, string only
+	Enum  []string // optional, string only
+	Units []string // systemd units to restart when this key changes
+	Hook  string   // shell command to run when this key changes, in addition to Units
+}
+
+// defaultSchema preserves the original hardcoded behavior (three bidder env
+// vars, restarting the "bidder" unit) for installs that don't pass --schema.
+func defaultSchema() *Schema {
+	return &Schema{Keys: []KeySpec{
+		{Env: envSmallBid, JSON: "small_bid", Type: "float", Units: []string{"bidder"}},
+		{Env: envLargeBid, JSON: "large_bid", Type: "float", Units: []string{"bidder"}},
+		{Env: envMaxConcurrency, JSON: "max_concurrency", Type: "int", Units: []string{"bidder"}},
+	}}
+}
+
+// loadSchema parses a schema file. It understands a deliberately small
+// subset of YAML: a top-level "keys:" list of maps, one "- field: value"
+// per entry, inline "[a, b]" lists for enum/units, everything else a plain
+// scalar. That's enough to express this config shape without pulling in a
+// YAML library.
+func loadSchema(path string) (*Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read schema %s: %w", path, err)
+	}
+
+	var schema Schema
+	var current *KeySpec
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || trimmed == "keys:" {
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "- ") {
+			if current != nil {
+				schema.Keys = append(schema.Keys, *current)
+			}
+			current = &KeySpec{}
+			trimmed = strings.TrimPrefix(trimmed, "- ")
+		}
+
+		if current == nil {
+			return nil, fmt.Errorf("schema: unexpected line outside a key entry: %q", line)
+		}
+		if err := applySchemaField(current, trimmed); err != nil {
+			return nil, fmt.Errorf("schema: %w", err)
+		}
+	}
+	if current != nil {
+		schema.Keys = append(schema.Keys, *current)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read schema %s: %w", path, err)
+	}
+
+	if len(schema.Keys) == 0 {
+		return nil, fmt.Errorf("schema %s declares no keys", path)
+	}
+	return &schema, nil
+}
+
+func applySchemaField(spec *KeySpec, fieldLine string) error {
+	idx := strings.Index(fieldLine, ":")
+	if idx < 0 {
+		return fmt.Errorf("expected \"field: value\", got %q", fieldLine)
+	}
+	key := strings.TrimSpace(fieldLine[:idx])
+	val := strings.TrimSpace(fieldLine[idx+1:])
+	val = strings.Trim(val, `"'`)
+
+	switch key {
+	case "env":
+		spec.Env = val
+	case "json":
+		spec.JSON = val
+	case "type":
+		spec.Type = val
+	case "min":
+		f, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return fmt.Errorf("invalid min %q: %w", val, err)
+		}
+		spec.Min = &f
+	case "max":
+		f, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return fmt.Errorf("invalid max %q: %w", val, err)
+		}
+		spec.Max = &f
+	case "regex":
+		spec.Regex = val
+	case "enum":
+		spec.Enum = parseInlineList(val)
+	case "units":
+		spec.Units = parseInlineList(val)
+	case "hook":
+		spec.Hook = val
+	default:
+		return fmt.Errorf("unknown field %q", key)
+	}
+	return nil
+}
+
+func parseInlineList(val string) []string {
+	val = strings.TrimSpace(val)
+	val = strings.TrimPrefix(val, "[")
+	val = strings.TrimSuffix(val, "]")
+	if val == "" {
+		return nil
+	}
+	parts := strings.Split(val, ",")
+	out := make([]string, 0, len(parts))
+	for _, p := range parts {
+		p = strings.TrimSpace(strings.Trim(strings.TrimSpace(p), `"'`))
+		if p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// evaluateKey pulls spec's field out of payload, validates it against the
+// spec's constraints, and formats it as the string that will be written to
+// the .env file. present is false if the payload simply didn't include this
+// key (not an error: dashboards may send partial payloads).
+func evaluateKey(spec KeySpec, payload ConfigPayload) (value string, present bool, err error) {
+	raw, ok := payload[spec.JSON]
+	if !ok || raw == nil {
+		return "", false, nil
+	}
+
+	switch spec.Type {
+	case "float":
+		f, ok := toFloat(raw)
+		if !ok {
+			return "", false, fmt.Errorf("key %s: expected a number, got %T", spec.Env, raw)
+		}
+		if err := validateRange(spec, f); err != nil {
+			return "", false, err
+		}
+		return formatFloat(f), true, nil
+
+	case "int":
+		f, ok := toFloat(raw)
+		if !ok || f != float64(int64(f)) {
+			return "", false, fmt.Errorf("key %s: expected an integer, got %v", spec.Env, raw)
+		}
+		if err := validateRange(spec, f); err != nil {
+			return "", false, err
+		}
+		return strconv.FormatInt(int64(f), 10), true, nil
+
+	case "bool":
+		b, ok := raw.(bool)
+		if !ok {
+			return "", false, fmt.Errorf("key %s: expected a bool, got %T", spec.Env, raw)
+		}
+		return strconv.FormatBool(b), true, nil
+
+	case "string":
+		s, ok := raw.(string)
+		if !ok {
+			return "", false, fmt.Errorf("key %s: expected a string, got %T", spec.Env, raw)
+		}
+		if err := validateString(spec, s); err != nil {
+			return "", false, err
+		}
+		return s, true, nil
+
+	default:
+		return "", false, fmt.Errorf("key %s: unknown schema type %q", spec.Env, spec.Type)
+	}
+}
+
+func toFloat(raw interface{}) (float64, bool) {
+	switch v := raw.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
+
+func validateRange(spec KeySpec, f float64) error {
+	if spec.Min != nil && f < *spec.Min {
+		return fmt.Errorf("key %s: value %v is below min %v", spec.Env, f, *spec.Min)
+	}
+	if spec.Max != nil && f > *spec.Max {
+		return fmt.Errorf("key %s: value %v is above max %v", spec.Env, f, *spec.Max)
+	}
+	return nil
+}
+
+func validateString(spec KeySpec, s string) error {
+	// .env files are newline-delimited, so an unvalidated string key could
+	// otherwise inject a "\nSOME_OTHER_VAR=..." line and set env vars the
+	// schema never declared. Reject CR and LF unconditionally, not just
+	// when a regex/enum happens to rule them out.
+	if strings.ContainsAny(s, "\r\n") {
+		return fmt.Errorf("key %s: value must not contain newlines", spec.Env)
+	}
+
+	if len(spec.Enum) > 0 {
+		valid := false
+		for _, e := range spec.Enum {
+			if s == e {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return fmt.Errorf("key %s: value %q is not one of %v", spec.Env, s, spec.Enum)
+		}
+	}
+	if spec.Regex != "" {
+		re, err := regexp.Compile(spec.Regex)
+		if err != nil {
+			return fmt.Errorf("key %s: invalid regex %q: %w", spec.Env, spec.Regex, err)
+		}
+		if !re.MatchString(s) {
+			return fmt.Errorf("key %s: value %q does not match pattern %q", spec.Env, s, spec.Regex)
+		}
+	}
+	return nil
+}
+
+// unitsAndHooksFor returns the deduplicated set of systemd units and shell
+// hooks to run given the set of env vars that changed, so a payload that
+// touches multiple keys targeting the same unit restarts it exactly once.
+func unitsAndHooksFor(schema *Schema, changedEnvVars map[string]bool) (units []string, hooks []string) {
+	seenUnit := make(map[string]bool)
+	seenHook := make(map[string]bool)
+
+	for _, spec := range schema.Keys {
+		if !changedEnvVars[spec.Env] {
+			continue
+		}
+		for _, u := range spec.Units {
+			if !seenUnit[u] {
+				seenUnit[u] = true
+				units = append(units, u)
+			}
+		}
+		if spec.Hook != "" && !seenHook[spec.Hook] {
+			seenHook[spec.Hook] = true
+			hooks = append(hooks, spec.Hook)
+		}
+	}
+	return units, hooks
+}
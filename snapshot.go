@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SnapshotConfig controls where/how many .env snapshots are kept before each
+// write. Dir == "" disables snapshotting entirely.
+type SnapshotConfig struct {
+	Dir  string
+	Keep int
+}
+
+// defaultSnapshotDir returns the snapshot directory for a given .env path:
+// <dir-of-env>/.env.d/history.
+func defaultSnapshotDir(envPath string) string {
+	return filepath.Join(filepath.Dir(envPath), ".env.d", "history")
+}
+
+// takeSnapshot copies the current contents of envPath into cfg.Dir, named
+// with a sortable timestamp plus a short content hash, and prunes old
+// snapshots down to cfg.Keep. It is a no-op if envPath does not yet exist
+// (nothing to roll back to) or snapshotting is disabled.
+func takeSnapshot(cfg SnapshotConfig, envPath string) (string, error) {
+	if cfg.Dir == "" {
+		return "", nil
+	}
+
+	data, err := os.ReadFile(envPath)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("read .env for snapshot: %w", err)
+	}
+
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return "", fmt.Errorf("create snapshot dir: %w", err)
+	}
+
+	id := fmt.Sprintf("%s-%s", time.Now().UTC().Format("20060102T150405Z"), shortSHA(data))
+	snapPath := filepath.Join(cfg.Dir, id+".env")
+
+	if err := os.WriteFile(snapPath, data, 0o600); err != nil {
+		return "", fmt.Errorf("write snapshot: %w", err)
+	}
+
+	if err := pruneSnapshots(cfg.Dir, cfg.Keep); err != nil {
+		log.Printf("snapshot: failed to prune old snapshots: %v", err)
+	}
+
+	log.Printf("snapshot: saved %s", snapPath)
+	return id, nil
+}
+
+// pruneSnapshots deletes the oldest snapshots in dir until at most keep
+// remain. keep <= 0 means unlimited.
+func pruneSnapshots(dir string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+
+	snaps, err := listSnapshotsOnDisk(dir)
+	if err != nil {
+		return err
+	}
+	if len(snaps) <= keep {
+		return nil
+	}
+
+	for _, s := range snaps[:len(snaps)-keep] {
+		if err := os.Remove(filepath.Join(dir, s.ID+".env")); err != nil {
+			return fmt.Errorf("remove old snapshot %s: %w", s.ID, err)
+		}
+	}
+	return nil
+}
+
+// SnapshotInfo describes one snapshot on disk.
+type SnapshotInfo struct {
+	ID      string
+	ModTime time.Time
+}
+
+// listSnapshotsOnDisk returns snapshots in dir, oldest first.
+func listSnapshotsOnDisk(dir string) ([]SnapshotInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read snapshot dir: %w", err)
+	}
+
+	var snaps []SnapshotInfo
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".env") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, fmt.Errorf("stat snapshot %s: %w", e.Name(), err)
+		}
+		snaps = append(snaps, SnapshotInfo{
+			ID:      strings.TrimSuffix(e.Name(), ".env"),
+			ModTime: info.ModTime(),
+		})
+	}
+
+	sort.Slice(snaps, func(i, j int) bool { return snaps[i].ID < snaps[j].ID })
+	return snaps, nil
+}
+
+// snapshotIDPattern matches the IDs takeSnapshot generates (a sortable UTC
+// timestamp plus an 8-hex-digit content hash). restoreSnapshot enforces this
+// on every caller's id before joining it into a path, since both the
+// --rollback flag and the dashboard's rollback form pass through user input.
+var snapshotIDPattern = regexp.MustCompile(`^\d{8}T\d{6}Z-[0-9a-f]{8}$`)
+
+// restoreSnapshot overwrites envPath with the contents of the snapshot
+// identified by id, atomically.
+func restoreSnapshot(dir, id, envPath string) error {
+	if !snapshotIDPattern.MatchString(id) {
+		return fmt.Errorf("invalid snapshot id %q", id)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, id+".env"))
+	if err != nil {
+		return fmt.Errorf("read snapshot %s: %w", id, err)
+	}
+	if err := writeFileAtomic(envPath, data); err != nil {
+		return fmt.Errorf("restore snapshot %s: %w", id, err)
+	}
+	log.Printf("snapshot: restored %s to %s", id, envPath)
+	return nil
+}
+
+// HealthCheck configures the post-restart probe used to decide whether a
+// deploy succeeded. Mode == "none" (the default) disables probing.
+type HealthCheck struct {
+	Mode      string // "none", "http", "exec", "systemd"
+	URL       string
+	Cmd       string
+	Stability time.Duration
+	Timeout   time.Duration
+}
+
+// probeHealthy polls the configured probe until it has reported healthy
+// continuously for hc.Stability, or returns an error once hc.Timeout
+// elapses without achieving that. units is only consulted by the "systemd"
+// mode, and should be whatever units were just restarted.
+func probeHealthy(ctx context.Context, hc HealthCheck, units []string) error {
+	if hc.Mode == "" || hc.Mode == "none" {
+		return nil
+	}
+
+	deadline := time.Now().Add(hc.Timeout)
+	var healthySince time.Time
+
+	for {
+		ok, err := runHealthProbe(ctx, hc, units)
+		now := time.Now()
+
+		if ok {
+			if healthySince.IsZero() {
+				healthySince = now
+			}
+			if now.Sub(healthySince) >= hc.Stability {
+				return nil
+			}
+		} else {
+			healthySince = time.Time{}
+			if err != nil {
+				log.Printf("health probe (%s): %v", hc.Mode, err)
+			}
+		}
+
+		if now.After(deadline) {
+			return fmt.Errorf("health probe (%s) did not stabilize within %s", hc.Mode, hc.Timeout)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func runHealthProbe(ctx context.Context, hc HealthCheck, units []string) (bool, error) {
+	switch hc.Mode {
+	case "http":
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, hc.URL, nil)
+		if err != nil {
+			return false, err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return false, err
+		}
+		defer resp.Body.Close()
+		return resp.StatusCode >= 200 && resp.StatusCode < 300, nil
+
+	case "exec":
+		cmd := exec.CommandContext(ctx, "/bin/sh", "-c", hc.Cmd)
+		return cmd.Run() == nil, nil
+
+	case "systemd":
+		// Check every unit this deploy actually restarted, not a hardcoded
+		// service name -- a schema can target any number of units now.
+		if len(units) == 0 {
+			return true, nil
+		}
+		for _, unit := range units {
+			cmd := exec.CommandContext(ctx, "systemctl", "is-active", "--quiet", unit)
+			if cmd.Run() != nil {
+				return false, nil
+			}
+		}
+		return true, nil
+
+	default:
+		return false, fmt.Errorf("unknown health check mode %q", hc.Mode)
+	}
+}
+
+// shortSHA is a small non-cryptographic fingerprint used only to keep
+// snapshot filenames unique when two snapshots land in the same second.
+func shortSHA(data []byte) string {
+	var h uint32 = 2166136261
+	for _, b := range data {
+		h ^= uint32(b)
+		h *= 16777619
+	}
+	return fmt.Sprintf("%08x", h)
+}
@@ -0,0 +1,520 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ConfigSource abstracts where config payloads come from, so the poll loop
+// doesn't need to know whether it's talking to the Succinct dashboard over
+// HTTP, a Consul KV entry, an etcd key, a local file, or a git repo.
+type ConfigSource interface {
+	// Fetch returns the current config payload.
+	Fetch(ctx context.Context) (ConfigPayload, error)
+	// Watch returns a channel of config payloads pushed as they change.
+	// Implementations that can't watch natively fall back to polling.
+	// The channel is closed when ctx is cancelled.
+	Watch(ctx context.Context) (<-chan ConfigPayload, error)
+}
+
+// parseSource builds a ConfigSource from a --source URL. Recognized
+// schemes: http(s)://, consul://, etcd://, file://, git://. An empty raw
+// string is not valid here; callers should fall back to a plain
+// httpConfigSource built from --endpoint instead.
+func parseSource(raw string, client *http.Client, pollInterval time.Duration) (ConfigSource, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --source %q: %w", raw, err)
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		return &httpConfigSource{endpoint: raw, client: client, pollInterval: pollInterval}, nil
+	case "consul":
+		return newConsulConfigSource(u, client)
+	case "etcd":
+		return newEtcdConfigSource(u, client)
+	case "file":
+		return &fileConfigSource{path: u.Path, pollInterval: pollInterval}, nil
+	case "git":
+		return newGitConfigSource(u, pollInterval)
+	default:
+		return nil, fmt.Errorf("unsupported --source scheme %q (want http(s)/consul/etcd/file/git)", u.Scheme)
+	}
+}
+
+// pollingWatch is the fallback Watch implementation shared by every source
+// that has no native push/long-poll mechanism: it calls Fetch on
+// pollInterval and forwards every payload it gets back. A Fetch error is
+// dropped without logging and the next tick tries again.
+func pollingWatch(ctx context.Context, interval time.Duration, fetch func(context.Context) (ConfigPayload, error)) (<-chan ConfigPayload, error) {
+	ch := make(chan ConfigPayload)
+	go func() {
+		defer close(ch)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				payload, err := fetch(ctx)
+				if err != nil {
+					continue
+				}
+				select {
+				case ch <- payload:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// httpConfigSource is the original behavior: GET a JSON endpoint.
+type httpConfigSource struct {
+	endpoint     string
+	client       *http.Client
+	pollInterval time.Duration
+}
+
+func (s *httpConfigSource) Fetch(ctx context.Context) (ConfigPayload, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.endpoint, nil)
+	if err != nil {
+		return ConfigPayload{}, err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return ConfigPayload{}, fmt.Errorf("failed to GET %s: %w", s.endpoint, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioReadAllLimit(resp.Body, 1024)
+		return ConfigPayload{}, fmt.Errorf("unexpected status %d from endpoint: %s", resp.StatusCode, string(body))
+	}
+
+	var payload ConfigPayload
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return ConfigPayload{}, fmt.Errorf("failed to decode JSON: %w", err)
+	}
+	return payload, nil
+}
+
+func (s *httpConfigSource) Watch(ctx context.Context) (<-chan ConfigPayload, error) {
+	return pollingWatch(ctx, s.pollInterval, s.Fetch)
+}
+
+// consulConfigSource reads a JSON config payload out of a single Consul KV
+// entry, e.g. --source consul://127.0.0.1:8500/bidder/config. Watch uses
+// Consul's blocking queries (?index=N&wait=30s) rather than polling.
+type consulConfigSource struct {
+	baseURL string // e.g. http://127.0.0.1:8500/v1/kv/bidder/config
+	client  *http.Client
+}
+
+func newConsulConfigSource(u *url.URL, client *http.Client) (*consulConfigSource, error) {
+	if u.Host == "" || u.Path == "" {
+		return nil, fmt.Errorf("consul source must be consul://host:port/key/path, got %q", u.String())
+	}
+	return &consulConfigSource{
+		baseURL: fmt.Sprintf("http://%s/v1/kv%s", u.Host, u.Path),
+		client:  client,
+	}, nil
+}
+
+// consulKVEntry mirrors the JSON shape Consul's KV API returns.
+type consulKVEntry struct {
+	Value string `json:"Value"` // base64-encoded
+}
+
+func (s *consulConfigSource) fetchAt(ctx context.Context, index string) (ConfigPayload, string, error) {
+	reqURL := s.baseURL + "?raw=false"
+	if index != "" {
+		reqURL = fmt.Sprintf("%s&index=%s&wait=30s", reqURL, url.QueryEscape(index))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return ConfigPayload{}, "", err
+	}
+	// A blocking query can run for the full wait=30s, longer than the shared
+	// client's Timeout, so it is bounded by ctx instead.
+	client := s.client
+	if index != "" {
+		c := *s.client
+		c.Timeout = 0
+		client = &c
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return ConfigPayload{}, "", fmt.Errorf("consul KV request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return ConfigPayload{}, "", fmt.Errorf("unexpected status %d from consul", resp.StatusCode)
+	}
+
+	var entries []consulKVEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return ConfigPayload{}, "", fmt.Errorf("failed to decode consul KV response: %w", err)
+	}
+	if len(entries) == 0 {
+		return ConfigPayload{}, "", fmt.Errorf("consul key not found")
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(entries[0].Value)
+	if err != nil {
+		return ConfigPayload{}, "", fmt.Errorf("failed to decode consul value: %w", err)
+	}
+
+	var payload ConfigPayload
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return ConfigPayload{}, "", fmt.Errorf("failed to decode consul payload JSON: %w", err)
+	}
+
+	return payload, resp.Header.Get("X-Consul-Index"), nil
+}
+
+func (s *consulConfigSource) Fetch(ctx context.Context) (ConfigPayload, error) {
+	payload, _, err := s.fetchAt(ctx, "")
+	return payload, err
+}
+
+func (s *consulConfigSource) Watch(ctx context.Context) (<-chan ConfigPayload, error) {
+	ch := make(chan ConfigPayload)
+	go func() {
+		defer close(ch)
+		index := ""
+		for {
+			if ctx.Err() != nil {
+				return
+			}
+			payload, nextIndex, err := s.fetchAt(ctx, index)
+			if err != nil {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(5 * time.Second):
+				}
+				continue
+			}
+			if nextIndex != index {
+				index = nextIndex
+				select {
+				case ch <- payload:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// etcdConfigSource reads a JSON config payload out of a single etcd v3 key
+// via the gRPC-gateway JSON API, e.g. --source etcd://127.0.0.1:2379/bidder/config.
+type etcdConfigSource struct {
+	baseURL string // e.g. http://127.0.0.1:2379
+	key     string
+	client  *http.Client
+}
+
+func newEtcdConfigSource(u *url.URL, client *http.Client) (*etcdConfigSource, error) {
+	if u.Host == "" || u.Path == "" {
+		return nil, fmt.Errorf("etcd source must be etcd://host:port/key/path, got %q", u.String())
+	}
+	return &etcdConfigSource{
+		baseURL: fmt.Sprintf("http://%s", u.Host),
+		key:     strings.TrimPrefix(u.Path, "/"),
+		client:  client,
+	}, nil
+}
+
+type etcdRangeRequest struct {
+	Key string `json:"key"`
+}
+
+type etcdKeyValue struct {
+	Value string `json:"value"` // base64
+}
+
+type etcdRangeResponse struct {
+	Kvs []etcdKeyValue `json:"kvs"`
+}
+
+func (s *etcdConfigSource) Fetch(ctx context.Context) (ConfigPayload, error) {
+	reqBody, err := json.Marshal(etcdRangeRequest{Key: base64.StdEncoding.EncodeToString([]byte(s.key))})
+	if err != nil {
+		return ConfigPayload{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.baseURL+"/v3/kv/range", bytes.NewReader(reqBody))
+	if err != nil {
+		return ConfigPayload{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return ConfigPayload{}, fmt.Errorf("etcd range request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return ConfigPayload{}, fmt.Errorf("unexpected status %d from etcd", resp.StatusCode)
+	}
+
+	var rangeResp etcdRangeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rangeResp); err != nil {
+		return ConfigPayload{}, fmt.Errorf("failed to decode etcd range response: %w", err)
+	}
+	if len(rangeResp.Kvs) == 0 {
+		return ConfigPayload{}, fmt.Errorf("etcd key %q not found", s.key)
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(rangeResp.Kvs[0].Value)
+	if err != nil {
+		return ConfigPayload{}, fmt.Errorf("failed to decode etcd value: %w", err)
+	}
+
+	var payload ConfigPayload
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return ConfigPayload{}, fmt.Errorf("failed to decode etcd payload JSON: %w", err)
+	}
+	return payload, nil
+}
+
+// Watch uses etcd's streaming /v3/watch endpoint: one JSON object per
+// newline-delimited chunk on the response body.
+func (s *etcdConfigSource) Watch(ctx context.Context) (<-chan ConfigPayload, error) {
+	watchReq := map[string]interface{}{
+		"create_request": map[string]interface{}{
+			"key": base64.StdEncoding.EncodeToString([]byte(s.key)),
+		},
+	}
+	body, err := json.Marshal(watchReq)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.baseURL+"/v3/watch", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// The shared client's Timeout would cut the long-lived stream off, so
+	// the watch request is bounded by ctx instead.
+	streamClient := *s.client
+	streamClient.Timeout = 0
+	resp, err := streamClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("etcd watch request failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %d from etcd watch", resp.StatusCode)
+	}
+
+	ch := make(chan ConfigPayload)
+	go func() {
+		defer close(ch)
+		defer resp.Body.Close()
+
+		decoder := json.NewDecoder(resp.Body)
+		for {
+			var event struct {
+				Result struct {
+					Events []struct {
+						Kv etcdKeyValue `json:"kv"`
+					} `json:"events"`
+				} `json:"result"`
+			}
+			if err := decoder.Decode(&event); err != nil {
+				return
+			}
+			for _, e := range event.Result.Events {
+				raw, err := base64.StdEncoding.DecodeString(e.Kv.Value)
+				if err != nil {
+					continue
+				}
+				var payload ConfigPayload
+				if err := json.Unmarshal(raw, &payload); err != nil {
+					continue
+				}
+				select {
+				case ch <- payload:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// fileConfigSource reads a JSON config payload from a local file, e.g.
+// --source file:///etc/bidder/config.json.
+//
+// Unlike consulConfigSource (blocking queries) and etcdConfigSource (native
+// streaming watch), Watch here polls the file's mtime on --interval rather
+// than using inotify: this tool is stdlib-only and fsnotify is the one way
+// to get genuine push semantics out of the local filesystem, so this source
+// is a deliberate exception to "eliminate polling latency" -- it trades
+// true push for not adding a dependency. mtime granularity also means two
+// writes within the same filesystem timestamp tick can coalesce into one
+// observed change.
+type fileConfigSource struct {
+	path         string
+	pollInterval time.Duration
+}
+
+func (s *fileConfigSource) Fetch(ctx context.Context) (ConfigPayload, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return ConfigPayload{}, fmt.Errorf("read config file %s: %w", s.path, err)
+	}
+	var payload ConfigPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return ConfigPayload{}, fmt.Errorf("failed to decode %s: %w", s.path, err)
+	}
+	return payload, nil
+}
+
+func (s *fileConfigSource) Watch(ctx context.Context) (<-chan ConfigPayload, error) {
+	ch := make(chan ConfigPayload)
+	go func() {
+		defer close(ch)
+		var lastMod time.Time
+		ticker := time.NewTicker(s.pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				info, err := os.Stat(s.path)
+				if err != nil {
+					continue
+				}
+				if !info.ModTime().After(lastMod) {
+					continue
+				}
+				lastMod = info.ModTime()
+				payload, err := s.Fetch(ctx)
+				if err != nil {
+					continue
+				}
+				select {
+				case ch <- payload:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// gitConfigSource pulls a git repo on an interval and reads a JSON config
+// payload from a path inside it, e.g.
+// --source git://github.com/org/infra-config.git#main:bidder/config.json
+type gitConfigSource struct {
+	repoURL      string
+	branch       string
+	filePath     string
+	workDir      string
+	pollInterval time.Duration
+}
+
+func newGitConfigSource(u *url.URL, pollInterval time.Duration) (*gitConfigSource, error) {
+	branch := "main"
+	filePath := ""
+	ref := u.Fragment // "branch:path"
+	if ref != "" {
+		parts := strings.SplitN(ref, ":", 2)
+		if parts[0] != "" {
+			branch = parts[0]
+		}
+		if len(parts) == 2 {
+			filePath = parts[1]
+		}
+	}
+	if filePath == "" {
+		return nil, fmt.Errorf("git source must include a file path, e.g. git://host/repo.git#branch:path/to/config.json")
+	}
+
+	repoURL := &url.URL{Scheme: "https", Host: u.Host, Path: u.Path}
+	workDir := filepath.Join(os.TempDir(), "succinct-updater-git-"+sanitizeForPath(u.Host+u.Path))
+
+	return &gitConfigSource{
+		repoURL:      repoURL.String(),
+		branch:       branch,
+		filePath:     filePath,
+		workDir:      workDir,
+		pollInterval: pollInterval,
+	}, nil
+}
+
+func (s *gitConfigSource) Fetch(ctx context.Context) (ConfigPayload, error) {
+	if err := s.syncRepo(ctx); err != nil {
+		return ConfigPayload{}, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(s.workDir, s.filePath))
+	if err != nil {
+		return ConfigPayload{}, fmt.Errorf("read %s from git checkout: %w", s.filePath, err)
+	}
+	var payload ConfigPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return ConfigPayload{}, fmt.Errorf("failed to decode %s: %w", s.filePath, err)
+	}
+	return payload, nil
+}
+
+func (s *gitConfigSource) Watch(ctx context.Context) (<-chan ConfigPayload, error) {
+	return pollingWatch(ctx, s.pollInterval, s.Fetch)
+}
+
+func (s *gitConfigSource) syncRepo(ctx context.Context) error {
+	if _, err := os.Stat(filepath.Join(s.workDir, ".git")); err == nil {
+		cmd := exec.CommandContext(ctx, "git", "-C", s.workDir, "pull", "--ff-only", "origin", s.branch)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("git pull failed: %w: %s", err, string(out))
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.workDir), 0o755); err != nil {
+		return fmt.Errorf("create git work dir: %w", err)
+	}
+	cmd := exec.CommandContext(ctx, "git", "clone", "--branch", s.branch, "--single-branch", s.repoURL, s.workDir)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git clone failed: %w: %s", err, string(out))
+	}
+	return nil
+}
+
+func sanitizeForPath(s string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '-'
+	}, s)
+}
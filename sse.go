@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// watchSSE opens a long-lived Server-Sent Events connection to streamURL and
+// calls apply with the decoded data of every event it receives; the event
+// type is not checked. On disconnect it
+// reconnects with a short backoff until ctx is cancelled.
+func watchSSE(ctx context.Context, client *http.Client, streamURL string, apply func(ConfigPayload)) {
+	backoff := time.Second
+
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err := streamOnce(ctx, client, streamURL, apply); err != nil {
+			log.Printf("sse: connection to %s ended: %v", streamURL, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+func streamOnce(ctx context.Context, client *http.Client, streamURL string, apply func(ConfigPayload)) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, streamURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, streamURL)
+	}
+
+	log.Printf("sse: connected to %s", streamURL)
+
+	scanner := bufio.NewScanner(resp.Body)
+	var dataLines []string
+
+	flush := func() {
+		if len(dataLines) == 0 {
+			return
+		}
+		data := strings.Join(dataLines, "\n")
+		dataLines = dataLines[:0]
+
+		var payload ConfigPayload
+		if err := json.Unmarshal([]byte(data), &payload); err != nil {
+			log.Printf("sse: failed to decode event data: %v", err)
+			return
+		}
+		apply(payload)
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case line == "":
+			// Blank line terminates an event.
+			flush()
+		case strings.HasPrefix(line, "data:"):
+			dataLines = append(dataLines, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		default:
+			// Ignore "event:", "id:", "retry:" and comment lines; we only
+			// care about the payload.
+		}
+	}
+
+	return scanner.Err()
+}
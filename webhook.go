@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxWebhookClockSkew = 5 * time.Minute
+
+// runWebhookReceiver starts an HTTP server that accepts signed config
+// pushes and calls apply for each valid one. It blocks until ctx is
+// cancelled.
+func runWebhookReceiver(ctx context.Context, addr, secret string, apply func(ConfigPayload)) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/webhook/config", func(w http.ResponseWriter, r *http.Request) {
+		handleWebhook(w, r, secret, apply)
+	})
+
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: mux,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("webhook: server error: %v", err)
+	}
+}
+
+func handleWebhook(w http.ResponseWriter, r *http.Request, secret string, apply func(ConfigPayload)) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+
+	timestampHeader := r.Header.Get("X-Timestamp")
+	if timestampHeader == "" {
+		http.Error(w, "missing X-Timestamp header", http.StatusBadRequest)
+		return
+	}
+	if err := checkTimestamp(timestampHeader); err != nil {
+		log.Printf("webhook: rejected request: %v", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	signature := r.Header.Get("X-Signature")
+	if signature == "" {
+		http.Error(w, "missing X-Signature header", http.StatusBadRequest)
+		return
+	}
+	if err := verifySignature(secret, timestampHeader, body, signature); err != nil {
+		log.Printf("webhook: signature verification failed: %v", err)
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	var payload ConfigPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("webhook: accepted signed config push")
+	apply(payload)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkTimestamp rejects requests whose X-Timestamp (unix seconds) is more
+// than maxWebhookClockSkew away from now, to prevent replays of old,
+// otherwise validly-signed payloads.
+func checkTimestamp(header string) error {
+	sec, err := strconv.ParseInt(header, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid X-Timestamp %q: %w", header, err)
+	}
+	skew := time.Since(time.Unix(sec, 0))
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > maxWebhookClockSkew {
+		return fmt.Errorf("X-Timestamp %q is outside the %s clock skew window", header, maxWebhookClockSkew)
+	}
+	return nil
+}
+
+// verifySignature recomputes HMAC-SHA256 over "<timestamp>.<body>" using
+// secret and compares it against the "sha256=<hex>" value in header, in
+// constant time.
+func verifySignature(secret, timestamp string, body []byte, header string) error {
+	const prefix = "sha256="
+	if !strings.HasPrefix(header, prefix) {
+		return fmt.Errorf("unsupported signature format %q", header)
+	}
+	got, err := hex.DecodeString(strings.TrimPrefix(header, prefix))
+	if err != nil {
+		return fmt.Errorf("malformed signature: %w", err)
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	want := mac.Sum(nil)
+
+	if subtle.ConstantTimeCompare(got, want) != 1 {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}